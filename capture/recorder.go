@@ -0,0 +1,284 @@
+// Package capture dumps the audio surrounding a loud event to a WAV
+// file, so the user can review what actually tripped EarGuard. It
+// keeps its own loopback stream and pre-trigger ring buffer rather
+// than sharing the loudness meter's, so a slow WAV write can never
+// stall loudness metering.
+package capture
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+	"unsafe"
+
+	"github.com/go-ole/go-ole"
+	"github.com/moutend/go-wca/pkg/wca"
+	"github.com/youpy/go-wav"
+)
+
+// Config controls how much audio is kept around a trigger and where
+// it's written.
+type Config struct {
+	LeadSeconds  float64
+	TrailSeconds float64
+	Dir          string
+	MaxFiles     int
+}
+
+// Recorder captures loopback audio into a pre-trigger ring buffer and,
+// on Trigger, splices in the following TrailSeconds and writes the
+// result to a timestamped WAV file.
+type Recorder struct {
+	config Config
+
+	audioClient   *wca.IAudioClient
+	captureClient *wca.IAudioCaptureClient
+	event         uintptr
+	sampleRate    uint32
+	channels      uint16
+
+	ring       *ringBuffer
+	leadFrames int
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// New activates the default render endpoint in shared, event-driven
+// loopback mode and prepares a pre-trigger ring buffer sized from
+// config.LeadSeconds.
+func New(device *wca.IMMDevice, config Config) (*Recorder, error) {
+	var audioClient *wca.IAudioClient
+	if err := device.Activate(wca.IID_IAudioClient, wca.CLSCTX_ALL, nil, &audioClient); err != nil {
+		return nil, fmt.Errorf("failed to activate audio client: %v", err)
+	}
+
+	var waveFormat *wca.WAVEFORMATEX
+	if err := audioClient.GetMixFormat(&waveFormat); err != nil {
+		audioClient.Release()
+		return nil, fmt.Errorf("failed to get mix format: %v", err)
+	}
+	defer ole.CoTaskMemFree(uintptr(unsafe.Pointer(waveFormat)))
+
+	const bufferDuration = 2 * time.Second
+	if err := audioClient.Initialize(
+		wca.AUDCLNT_SHAREMODE_SHARED,
+		wca.AUDCLNT_STREAMFLAGS_LOOPBACK|wca.AUDCLNT_STREAMFLAGS_EVENTCALLBACK,
+		wca.REFERENCE_TIME(bufferDuration/100),
+		0,
+		waveFormat,
+		nil,
+	); err != nil {
+		audioClient.Release()
+		return nil, fmt.Errorf("failed to initialize loopback client: %v", err)
+	}
+
+	event := wca.CreateEventExA(0, 0, 0, 0)
+	if event == 0 {
+		audioClient.Release()
+		return nil, fmt.Errorf("failed to create capture event")
+	}
+	if err := audioClient.SetEventHandle(event); err != nil {
+		audioClient.Release()
+		return nil, fmt.Errorf("failed to set event handle: %v", err)
+	}
+
+	var captureClient *wca.IAudioCaptureClient
+	if err := audioClient.GetService(wca.IID_IAudioCaptureClient, &captureClient); err != nil {
+		audioClient.Release()
+		return nil, fmt.Errorf("failed to get capture client: %v", err)
+	}
+
+	if err := audioClient.Start(); err != nil {
+		captureClient.Release()
+		audioClient.Release()
+		return nil, fmt.Errorf("failed to start loopback capture: %v", err)
+	}
+
+	if config.Dir == "" {
+		config.Dir = "."
+	}
+	if err := os.MkdirAll(config.Dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create capture directory: %v", err)
+	}
+
+	leadFrames := int(config.LeadSeconds * float64(waveFormat.NSamplesPerSec))
+	if leadFrames < 1 {
+		leadFrames = 1
+	}
+	trailFrames := int(config.TrailSeconds * float64(waveFormat.NSamplesPerSec))
+
+	// The ring must hold enough history for whichever of lead/trail is
+	// longer: Trigger reads the pre-roll from it via Last(leadFrames)
+	// and the post-roll via Since(mark), and Since can only return up
+	// to the ring's capacity.
+	ringFrames := leadFrames
+	if trailFrames > ringFrames {
+		ringFrames = trailFrames
+	}
+
+	return &Recorder{
+		config:        config,
+		audioClient:   audioClient,
+		captureClient: captureClient,
+		event:         event,
+		sampleRate:    waveFormat.NSamplesPerSec,
+		channels:      waveFormat.NChannels,
+		ring:          newRingBuffer(ringFrames),
+		leadFrames:    leadFrames,
+		stop:          make(chan struct{}),
+		done:          make(chan struct{}),
+	}, nil
+}
+
+// Run continuously feeds captured frames into the pre-trigger ring
+// buffer until Close is called. It signals done on return so Close can
+// wait for it before releasing the underlying COM objects, since Run
+// may still be blocked in WaitForSingleObject or mid-GetBuffer when
+// Close is requested.
+func (r *Recorder) Run() {
+	defer close(r.done)
+	for {
+		select {
+		case <-r.stop:
+			return
+		default:
+		}
+
+		if res := wca.WaitForSingleObject(r.event, 200); res != 0 {
+			continue
+		}
+
+		var packetLength uint32
+		if err := r.captureClient.GetNextPacketSize(&packetLength); err != nil {
+			continue
+		}
+		for packetLength != 0 {
+			var data *byte
+			var numFrames uint32
+			var flags uint32
+			if err := r.captureClient.GetBuffer(&data, &numFrames, &flags, nil, nil); err != nil {
+				break
+			}
+			r.ring.Write(deinterleave(data, int(numFrames), int(r.channels)))
+			if err := r.captureClient.ReleaseBuffer(numFrames); err != nil {
+				break
+			}
+			if err := r.captureClient.GetNextPacketSize(&packetLength); err != nil {
+				break
+			}
+		}
+	}
+}
+
+// Trigger splices the pre-trigger ring buffer with the following
+// TrailSeconds of audio and writes it to a timestamped WAV file named
+// earguard-YYYYMMDD-HHMMSS-<peakdb>.wav. It blocks for TrailSeconds,
+// so callers should invoke it in its own goroutine.
+func (r *Recorder) Trigger(peakDB float64) error {
+	pre := r.ring.Last(r.leadFrames)
+	mark := r.ring.Mark()
+
+	time.Sleep(time.Duration(r.config.TrailSeconds * float64(time.Second)))
+	post := r.ring.Since(mark)
+
+	frames := append(pre, post...)
+
+	name := fmt.Sprintf("earguard-%s-%.0fdb.wav", time.Now().Format("20060102-150405"), peakDB)
+	path := filepath.Join(r.config.Dir, name)
+	if err := writeWav(path, frames, r.sampleRate, r.channels); err != nil {
+		return fmt.Errorf("failed to write capture %s: %v", path, err)
+	}
+
+	return r.enforceMaxFiles()
+}
+
+func (r *Recorder) enforceMaxFiles() error {
+	if r.config.MaxFiles <= 0 {
+		return nil
+	}
+	entries, err := os.ReadDir(r.config.Dir)
+	if err != nil {
+		return err
+	}
+
+	var names []string
+	for _, e := range entries {
+		if !e.IsDir() && filepath.Ext(e.Name()) == ".wav" {
+			names = append(names, e.Name())
+		}
+	}
+	sort.Strings(names) // timestamped names sort oldest-first
+
+	for len(names) > r.config.MaxFiles {
+		if err := os.Remove(filepath.Join(r.config.Dir, names[0])); err != nil {
+			return err
+		}
+		names = names[1:]
+	}
+	return nil
+}
+
+// Close stops Run, waits for it to return, and releases its COM
+// objects. It must not be called before Run has started.
+func (r *Recorder) Close() {
+	close(r.stop)
+	<-r.done
+	r.audioClient.Stop()
+	r.captureClient.Release()
+	r.audioClient.Release()
+	wca.CloseHandle(r.event)
+}
+
+func deinterleave(data *byte, numFrames, channels int) [][]float32 {
+	src := (*(*[1 << 28]float32)(unsafe.Pointer(data)))[: numFrames*channels : numFrames*channels]
+	frames := make([][]float32, numFrames)
+	for i := 0; i < numFrames; i++ {
+		frame := make([]float32, channels)
+		copy(frame, src[i*channels:(i+1)*channels])
+		frames[i] = frame
+	}
+	return frames
+}
+
+// writeWav down-mixes frames (one []float32 per frame, channels
+// interleaved) to stereo and writes them as 16-bit PCM via go-wav,
+// whose Sample type only has room for 2 channels.
+func writeWav(path string, frames [][]float32, sampleRate uint32, channels uint16) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	writer := wav.NewWriter(f, uint32(len(frames)), 2, sampleRate, 16)
+	samples := make([]wav.Sample, len(frames))
+	for i, frame := range frames {
+		l, r := downmixToStereo(frame, int(channels))
+		samples[i] = wav.Sample{Values: [2]int{int(l * 32767), int(r * 32767)}}
+	}
+	return writer.WriteSamples(samples)
+}
+
+// downmixToStereo collapses an arbitrary-channel frame to left/right,
+// averaging any channels beyond the first two into both, so surround
+// sources (e.g. 5.1) still produce a sensible stereo capture.
+func downmixToStereo(frame []float32, channels int) (left, right float32) {
+	if channels <= 0 || len(frame) == 0 {
+		return 0, 0
+	}
+	if channels == 1 {
+		return frame[0], frame[0]
+	}
+
+	left, right = frame[0], frame[1]
+	n := float32(1)
+	for ch := 2; ch < channels && ch < len(frame); ch++ {
+		left += frame[ch]
+		right += frame[ch]
+		n++
+	}
+	return left / n, right / n
+}
@@ -0,0 +1,99 @@
+package capture
+
+import "sync"
+
+// ringBuffer is a fixed-capacity circular buffer of interleaved PCM
+// float32 frames, used to keep a rolling window of recently-captured
+// audio so a trigger can look backward in time without having
+// buffered the whole session. It's written from the capture goroutine
+// and read from the trigger goroutine, so access is mutex-guarded.
+type ringBuffer struct {
+	mu sync.Mutex
+
+	frames   [][]float32 // each entry is one frame, channels interleaved
+	capacity int
+	next     int
+	full     bool
+	written  int // monotonic count of frames ever written, for Since
+}
+
+func newRingBuffer(capacity int) *ringBuffer {
+	return &ringBuffer{frames: make([][]float32, capacity), capacity: capacity}
+}
+
+// Write appends frames to the buffer, overwriting the oldest entries
+// once capacity is reached.
+func (r *ringBuffer) Write(frames [][]float32) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, f := range frames {
+		r.frames[r.next] = f
+		r.next = (r.next + 1) % r.capacity
+		if r.next == 0 {
+			r.full = true
+		}
+		r.written++
+	}
+}
+
+// Snapshot returns all buffered frames in chronological order.
+func (r *ringBuffer) Snapshot() [][]float32 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.snapshotLocked()
+}
+
+func (r *ringBuffer) snapshotLocked() [][]float32 {
+	if !r.full {
+		out := make([][]float32, r.next)
+		copy(out, r.frames[:r.next])
+		return out
+	}
+	out := make([][]float32, r.capacity)
+	copy(out, r.frames[r.next:])
+	copy(out[r.capacity-r.next:], r.frames[:r.next])
+	return out
+}
+
+// Last returns the most recent n buffered frames, oldest first. If
+// fewer than n frames have been buffered, all of them are returned.
+func (r *ringBuffer) Last(n int) [][]float32 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	all := r.snapshotLocked()
+	if n > len(all) {
+		n = len(all)
+	}
+	return all[len(all)-n:]
+}
+
+// Mark returns a cursor identifying the current write position, for
+// use with Since.
+func (r *ringBuffer) Mark() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.written
+}
+
+// Since returns the frames written after mark, oldest first. If more
+// frames than the buffer's capacity have been written since mark, only
+// the most recent capacity of them are returned, since the rest were
+// already overwritten.
+func (r *ringBuffer) Since(mark int) [][]float32 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	count := r.written - mark
+	if count <= 0 {
+		return nil
+	}
+	if count > r.capacity {
+		count = r.capacity
+	}
+
+	all := r.snapshotLocked()
+	if count > len(all) {
+		count = len(all)
+	}
+	return all[len(all)-count:]
+}
@@ -0,0 +1,87 @@
+package capture
+
+import (
+	"reflect"
+	"testing"
+)
+
+func frame(v float32) []float32 { return []float32{v} }
+
+func TestRingBufferSnapshotBeforeWrap(t *testing.T) {
+	r := newRingBuffer(4)
+	r.Write([][]float32{frame(1), frame(2)})
+
+	got := r.Snapshot()
+	want := [][]float32{frame(1), frame(2)}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Snapshot() = %v, want %v", got, want)
+	}
+}
+
+func TestRingBufferSnapshotAfterWrap(t *testing.T) {
+	r := newRingBuffer(3)
+	r.Write([][]float32{frame(1), frame(2), frame(3), frame(4), frame(5)})
+
+	got := r.Snapshot()
+	want := [][]float32{frame(3), frame(4), frame(5)}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Snapshot() = %v, want %v", got, want)
+	}
+}
+
+func TestRingBufferSince(t *testing.T) {
+	r := newRingBuffer(4)
+	r.Write([][]float32{frame(1), frame(2)})
+	mark := r.Mark()
+	r.Write([][]float32{frame(3), frame(4)})
+
+	got := r.Since(mark)
+	want := [][]float32{frame(3), frame(4)}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Since(mark) = %v, want %v", got, want)
+	}
+}
+
+func TestRingBufferSinceTruncatesToCapacity(t *testing.T) {
+	r := newRingBuffer(2)
+	mark := r.Mark()
+	r.Write([][]float32{frame(1), frame(2), frame(3)})
+
+	got := r.Since(mark)
+	want := [][]float32{frame(2), frame(3)}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Since(mark) = %v, want %v", got, want)
+	}
+}
+
+func TestRingBufferLast(t *testing.T) {
+	r := newRingBuffer(4)
+	r.Write([][]float32{frame(1), frame(2), frame(3), frame(4)})
+
+	got := r.Last(2)
+	want := [][]float32{frame(3), frame(4)}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Last(2) = %v, want %v", got, want)
+	}
+}
+
+func TestRingBufferLastFewerThanRequested(t *testing.T) {
+	r := newRingBuffer(4)
+	r.Write([][]float32{frame(1), frame(2)})
+
+	got := r.Last(4)
+	want := [][]float32{frame(1), frame(2)}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Last(4) = %v, want %v", got, want)
+	}
+}
+
+func TestRingBufferSinceNoNewFrames(t *testing.T) {
+	r := newRingBuffer(4)
+	r.Write([][]float32{frame(1)})
+	mark := r.Mark()
+
+	if got := r.Since(mark); got != nil {
+		t.Errorf("Since(mark) = %v, want nil", got)
+	}
+}
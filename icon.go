@@ -0,0 +1,6 @@
+package main
+
+// trayIcon is the tray icon shown by the tray subsystem. Replace this
+// with a real embedded .ico (e.g. via go:embed) before shipping; an
+// empty icon just falls back to the OS default tray glyph.
+var trayIcon = []byte{}
@@ -0,0 +1,295 @@
+// Package loudness implements a subset of ITU-R BS.1770 / EBU R128
+// perceptual loudness measurement: K-weighting, momentary and short-term
+// integrated loudness, and a true-peak estimate. It is used in place of
+// raw peak metering so that EarGuard reacts to how loud audio actually
+// sounds rather than to its raw sample amplitude.
+package loudness
+
+import (
+	"math"
+	"sync"
+)
+
+// Channel weights per BS.1770 Table 1. Surround channels (Ls/Rs) are
+// weighted higher than the front channels to account for their
+// contribution to perceived loudness.
+const (
+	WeightFrontCenter = 1.0
+	WeightSurround    = 1.41
+)
+
+// True-peak oversampling factor and FIR length, per BS.1770 Annex 2's
+// 4x true-peak measurement. truePeakCoeffs holds one set of tap weights
+// per oversampled phase, windowed-sinc designed so that phase 0 recovers
+// the original sample stream and the other phases interpolate the
+// inter-sample waveform; unlike linear interpolation, the sinc's
+// passband ripple lets an interpolated phase genuinely exceed the
+// surrounding sample magnitudes, which is the point of true-peak
+// detection.
+const (
+	truePeakOversample = 4
+	truePeakTaps       = 8
+)
+
+var truePeakCoeffs [truePeakOversample][truePeakTaps]float64
+
+func init() {
+	n := truePeakTaps * truePeakOversample
+	center := float64(n) / 2
+	for p := 0; p < truePeakOversample; p++ {
+		for k := 0; k < truePeakTaps; k++ {
+			x := (float64(k*truePeakOversample+p) - center) / truePeakOversample
+			truePeakCoeffs[p][k] = sinc(x) * hann(float64(k*truePeakOversample+p), float64(n))
+		}
+	}
+}
+
+func sinc(x float64) float64 {
+	if x == 0 {
+		return 1
+	}
+	return math.Sin(math.Pi*x) / (math.Pi * x)
+}
+
+func hann(n, nMinus1 float64) float64 {
+	return 0.5 - 0.5*math.Cos(2*math.Pi*n/nMinus1)
+}
+
+// biquad is a direct-form-II transposed biquad filter section.
+type biquad struct {
+	b0, b1, b2 float64
+	a1, a2     float64
+	z1, z2     float64
+}
+
+func (f *biquad) process(x float64) float64 {
+	y := f.b0*x + f.z1
+	f.z1 = f.b1*x - f.a1*y + f.z2
+	f.z2 = f.b2*x - f.a2*y
+	return y
+}
+
+// newPreFilter builds the BS.1770 stage-1 high-shelf ("pre-filter"),
+// approximately +4 dB above ~1681 Hz, for the given sample rate.
+func newPreFilter(sampleRate float64) biquad {
+	f0 := 1681.974450955533
+	g := 3.999843853973347
+	q := 0.7071752369554193
+
+	k := math.Tan(math.Pi * f0 / sampleRate)
+	vh := math.Pow(10, g/20)
+	vb := math.Pow(vh, 0.4996667741545416)
+
+	a0 := 1 + k/q + k*k
+	b0 := (vh + vb*k/q + k*k) / a0
+	b1 := 2 * (k*k - vh) / a0
+	b2 := (vh - vb*k/q + k*k) / a0
+	a1 := 2 * (k*k - 1) / a0
+	a2 := (1 - k/q + k*k) / a0
+
+	return biquad{b0: b0, b1: b1, b2: b2, a1: a1, a2: a2}
+}
+
+// newRLBFilter builds the BS.1770 stage-2 high-pass ("RLB weighting"),
+// a simple first-order high-pass around 38 Hz modeled as a biquad.
+func newRLBFilter(sampleRate float64) biquad {
+	f0 := 38.13547087602444
+	q := 0.5003270373238773
+
+	k := math.Tan(math.Pi * f0 / sampleRate)
+	a0 := 1 + k/q + k*k
+	b0 := 1.0
+	b1 := -2.0
+	b2 := 1.0
+	a1 := 2 * (k*k - 1) / a0
+	a2 := (1 - k/q + k*k) / a0
+
+	return biquad{b0: b0 / a0, b1: b1 / a0, b2: b2 / a0, a1: a1, a2: a2}
+}
+
+// channel holds the per-channel K-weighting filter chain and its
+// BS.1770 channel weight.
+type channel struct {
+	pre    biquad
+	rlb    biquad
+	weight float64
+
+	// peakHist is a ring buffer of the last truePeakTaps raw samples,
+	// feeding the true-peak oversampling filter. peakPos is the index
+	// of the oldest sample currently held.
+	peakHist [truePeakTaps]float64
+	peakPos  int
+}
+
+// Meter accumulates K-weighted energy over a sliding window and reports
+// loudness in LUFS, following ITU-R BS.1770-4 / EBU R128.
+type Meter struct {
+	// mu guards every field below: AddSamples runs on the loopback
+	// capture goroutine while Momentary/ShortTerm/TruePeakDB/
+	// ResetTruePeak are called from the monitor loop goroutine.
+	mu sync.Mutex
+
+	sampleRate float64
+	channels   []channel
+	blockSize  int
+
+	// blockEnergies holds the channel-weighted mean-square energy of
+	// each completed 100 ms block, oldest first; no gating is applied.
+	blockEnergies []float64
+	maxBlocks     int // enough for the short-term (3 s) window
+
+	// per-block accumulation state
+	samplesInBlock int
+	sumSquares     []float64
+
+	truePeak float64
+}
+
+// New creates a Meter for the given sample rate and channel layout.
+// surround[i] marks channel i as a surround channel (weight 1.41); all
+// other channels are weighted 1.0.
+func New(sampleRate float64, numChannels int, surround []bool) *Meter {
+	m := &Meter{
+		sampleRate: sampleRate,
+		blockSize:  int(sampleRate * 0.1), // 100 ms blocks
+		maxBlocks:  30,                    // 30 * 100ms = 3s short-term window
+	}
+	for i := 0; i < numChannels; i++ {
+		w := WeightFrontCenter
+		if i < len(surround) && surround[i] {
+			w = WeightSurround
+		}
+		m.channels = append(m.channels, channel{
+			pre:    newPreFilter(sampleRate),
+			rlb:    newRLBFilter(sampleRate),
+			weight: w,
+		})
+	}
+	m.sumSquares = make([]float64, numChannels)
+	return m
+}
+
+// AddSamples feeds deinterleaved PCM float32 samples (one slice per
+// channel, all the same length) into the meter. It updates the
+// true-peak estimate and rolls completed 100 ms blocks into the
+// momentary/short-term history.
+func (m *Meter) AddSamples(perChannel [][]float32) {
+	if len(perChannel) == 0 {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n := len(perChannel[0])
+	for i := 0; i < n; i++ {
+		for ch := range m.channels {
+			x := float64(perChannel[ch][i])
+			m.updateTruePeak(ch, x)
+
+			y := m.channels[ch].pre.process(x)
+			y = m.channels[ch].rlb.process(y)
+			m.sumSquares[ch] += y * y
+		}
+		m.samplesInBlock++
+		if m.samplesInBlock >= m.blockSize {
+			m.flushBlock()
+		}
+	}
+}
+
+func (m *Meter) flushBlock() {
+	var energy float64
+	for ch, c := range m.channels {
+		energy += c.weight * (m.sumSquares[ch] / float64(m.samplesInBlock))
+		m.sumSquares[ch] = 0
+	}
+	m.samplesInBlock = 0
+
+	m.blockEnergies = append(m.blockEnergies, energy)
+	if len(m.blockEnergies) > m.maxBlocks {
+		m.blockEnergies = m.blockEnergies[len(m.blockEnergies)-m.maxBlocks:]
+	}
+}
+
+// energyToLUFS converts mean-square energy to LUFS per BS.1770.
+func energyToLUFS(energy float64) float64 {
+	if energy <= 0 {
+		return math.Inf(-1)
+	}
+	return -0.691 + 10*math.Log10(energy)
+}
+
+// Momentary returns the 400 ms momentary loudness in LUFS, ungated.
+func (m *Meter) Momentary() float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.windowLoudness(4)
+}
+
+// ShortTerm returns the 3 s short-term loudness in LUFS, ungated.
+func (m *Meter) ShortTerm() float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.windowLoudness(m.maxBlocks)
+}
+
+func (m *Meter) windowLoudness(numBlocks int) float64 {
+	if len(m.blockEnergies) == 0 {
+		return math.Inf(-1)
+	}
+	if numBlocks > len(m.blockEnergies) {
+		numBlocks = len(m.blockEnergies)
+	}
+	window := m.blockEnergies[len(m.blockEnergies)-numBlocks:]
+	var sum float64
+	for _, e := range window {
+		sum += e
+	}
+	return energyToLUFS(sum / float64(len(window)))
+}
+
+// updateTruePeak estimates inter-sample peaks by running the channel's
+// raw sample history through a 4x polyphase windowed-sinc oversampling
+// filter, per BS.1770 Annex 2, and updating the running true-peak hold
+// with the largest oversampled magnitude seen.
+func (m *Meter) updateTruePeak(ch int, x float64) {
+	c := &m.channels[ch]
+	c.peakHist[c.peakPos] = x
+	c.peakPos = (c.peakPos + 1) % truePeakTaps // now indexes the oldest sample
+
+	for p := 0; p < truePeakOversample; p++ {
+		var acc float64
+		for k := 0; k < truePeakTaps; k++ {
+			acc += c.peakHist[(c.peakPos+k)%truePeakTaps] * truePeakCoeffs[p][k]
+		}
+		if abs := math.Abs(acc); abs > m.truePeak {
+			m.truePeak = abs
+		}
+	}
+}
+
+// TruePeak returns the highest oversampled absolute sample value seen
+// since the meter was created or last reset, as a linear scalar.
+func (m *Meter) TruePeak() float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.truePeak
+}
+
+// TruePeakDB returns TruePeak expressed in dBTP (0 dBTP == full scale).
+func (m *Meter) TruePeakDB() float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.truePeak <= 0 {
+		return math.Inf(-1)
+	}
+	return 20 * math.Log10(m.truePeak)
+}
+
+// ResetTruePeak clears the true-peak hold so a new safety window can
+// start from 0.
+func (m *Meter) ResetTruePeak() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.truePeak = 0
+}
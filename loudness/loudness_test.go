@@ -0,0 +1,114 @@
+package loudness
+
+import (
+	"math"
+	"testing"
+)
+
+func TestMeterSilenceIsNegativeInfinity(t *testing.T) {
+	m := New(48000, 1, nil)
+	m.AddSamples([][]float32{make([]float32, 4800)})
+
+	if got := m.Momentary(); !math.IsInf(got, -1) {
+		t.Errorf("Momentary() for silence = %v, want -Inf", got)
+	}
+	if got := m.ShortTerm(); !math.IsInf(got, -1) {
+		t.Errorf("ShortTerm() for silence = %v, want -Inf", got)
+	}
+}
+
+func TestMeterMomentaryNoSamples(t *testing.T) {
+	m := New(48000, 1, nil)
+	if got := m.Momentary(); !math.IsInf(got, -1) {
+		t.Errorf("Momentary() with no samples = %v, want -Inf", got)
+	}
+}
+
+func TestMeterLouderSignalReadsHigher(t *testing.T) {
+	quiet := New(48000, 1, nil)
+	loud := New(48000, 1, nil)
+
+	samples := make([]float32, 4800)
+	for i := range samples {
+		samples[i] = 0.1
+	}
+	quiet.AddSamples([][]float32{samples})
+
+	for i := range samples {
+		samples[i] = 0.9
+	}
+	loud.AddSamples([][]float32{samples})
+
+	if loud.Momentary() <= quiet.Momentary() {
+		t.Errorf("louder signal read %.2f LUFS, want higher than quieter signal's %.2f LUFS", loud.Momentary(), quiet.Momentary())
+	}
+}
+
+func TestMeterTruePeak(t *testing.T) {
+	m := New(48000, 1, nil)
+	m.AddSamples([][]float32{{0, 0.5, -0.8, 0.2}})
+
+	if got := m.TruePeak(); got <= 0 {
+		t.Errorf("TruePeak() = %v, want > 0", got)
+	}
+
+	wantDB := 20 * math.Log10(m.TruePeak())
+	if got := m.TruePeakDB(); math.Abs(got-wantDB) > 1e-9 {
+		t.Errorf("TruePeakDB() = %v, want %v", got, wantDB)
+	}
+}
+
+// TestMeterTruePeakExceedsSamplePeak exercises the oversampling filter
+// against a near-Nyquist burst, the classic case where the
+// reconstructed continuous waveform overshoots every individual
+// sample's magnitude ("inter-sample peak"). A linear-interpolation
+// true-peak detector can never see this, since linear interpolation's
+// maximum over a segment is always at one of its endpoints.
+func TestMeterTruePeakExceedsSamplePeak(t *testing.T) {
+	m := New(48000, 1, nil)
+	samples := []float32{0.95, -0.95, 0.95, -0.95, 0.95, -0.95}
+	m.AddSamples([][]float32{samples})
+
+	var samplePeak float64
+	for _, s := range samples {
+		if abs := math.Abs(float64(s)); abs > samplePeak {
+			samplePeak = abs
+		}
+	}
+
+	if got := m.TruePeak(); got <= samplePeak {
+		t.Errorf("TruePeak() = %v, want > sample peak %v (inter-sample overshoot)", got, samplePeak)
+	}
+}
+
+func TestMeterResetTruePeak(t *testing.T) {
+	m := New(48000, 1, nil)
+	m.AddSamples([][]float32{{0, 1, 0}})
+	if m.TruePeak() == 0 {
+		t.Fatal("TruePeak() = 0 after loud samples, want > 0")
+	}
+
+	m.ResetTruePeak()
+	if got := m.TruePeak(); got != 0 {
+		t.Errorf("TruePeak() after ResetTruePeak = %v, want 0", got)
+	}
+	if got := m.TruePeakDB(); !math.IsInf(got, -1) {
+		t.Errorf("TruePeakDB() after ResetTruePeak = %v, want -Inf", got)
+	}
+}
+
+func TestMeterSurroundChannelWeightedHigher(t *testing.T) {
+	front := New(48000, 1, nil)
+	surround := New(48000, 1, []bool{true})
+
+	samples := make([]float32, 4800)
+	for i := range samples {
+		samples[i] = 0.5
+	}
+	front.AddSamples([][]float32{samples})
+	surround.AddSamples([][]float32{samples})
+
+	if surround.Momentary() <= front.Momentary() {
+		t.Errorf("surround-weighted channel read %.2f LUFS, want higher than front-weighted %.2f LUFS", surround.Momentary(), front.Momentary())
+	}
+}
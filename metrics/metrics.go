@@ -0,0 +1,173 @@
+// Package metrics exposes EarGuard's runtime state as Prometheus
+// metrics and a Server-Sent Events stream, so ear-safety events can be
+// graphed and alerted on when EarGuard is running headless in the
+// tray.
+package metrics
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Event is one duck/restore occurrence, published both to /events and
+// to the structured log.
+type Event struct {
+	Timestamp      time.Time `json:"timestamp"`
+	Kind           string    `json:"kind"` // "duck" or "restore"
+	Peak           float64   `json:"peak"`
+	Threshold      float64   `json:"threshold"`
+	OriginalVolume float32   `json:"original_volume"`
+	NewVolume      float32   `json:"new_volume"`
+	Process        string    `json:"process,omitempty"`
+}
+
+// Server registers the earguard_* Prometheus metrics and serves them,
+// plus an SSE event stream, over HTTP.
+type Server struct {
+	MomentaryLUFS       prometheus.Gauge
+	ShortTermLUFS       prometheus.Gauge
+	CurrentVolume       prometheus.Gauge
+	Reduced             prometheus.Gauge
+	DucksTotal          prometheus.Counter
+	DuckDurationSeconds prometheus.Histogram
+
+	// Peak and AvgPeak are deprecated aliases for MomentaryLUFS and
+	// ShortTermLUFS under their original pre-LUFS metric names, kept
+	// so dashboards built against earguard_peak/earguard_avg_peak
+	// don't silently break.
+	Peak    prometheus.Gauge
+	AvgPeak prometheus.Gauge
+
+	registry *prometheus.Registry
+
+	mu          sync.Mutex
+	subscribers map[chan Event]struct{}
+}
+
+// New builds a Server with its own Prometheus registry, so it doesn't
+// collide with metrics from other libraries sharing the process.
+func New() *Server {
+	s := &Server{
+		MomentaryLUFS: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "earguard_momentary_lufs",
+			Help: "Momentary (400ms) loudness in LUFS, per ITU-R BS.1770.",
+		}),
+		ShortTermLUFS: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "earguard_short_term_lufs",
+			Help: "Short-term (3s) loudness in LUFS, per ITU-R BS.1770.",
+		}),
+		CurrentVolume: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "earguard_current_volume",
+			Help: "Current endpoint master volume (0.0-1.0).",
+		}),
+		Reduced: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "earguard_reduced",
+			Help: "1 if volume is currently ducked, 0 otherwise.",
+		}),
+		DucksTotal: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "earguard_ducks_total",
+			Help: "Total number of times EarGuard has ducked the volume.",
+		}),
+		DuckDurationSeconds: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "earguard_duck_duration_seconds",
+			Help:    "How long each duck lasted before being restored.",
+			Buckets: prometheus.DefBuckets,
+		}),
+		Peak: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "earguard_peak",
+			Help: "Deprecated alias for earguard_momentary_lufs.",
+		}),
+		AvgPeak: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "earguard_avg_peak",
+			Help: "Deprecated alias for earguard_short_term_lufs.",
+		}),
+		registry:    prometheus.NewRegistry(),
+		subscribers: make(map[chan Event]struct{}),
+	}
+	s.registry.MustRegister(s.MomentaryLUFS, s.ShortTermLUFS, s.CurrentVolume, s.Reduced, s.DucksTotal, s.DuckDurationSeconds, s.Peak, s.AvgPeak)
+	return s
+}
+
+// SetLoudness records the current momentary and short-term loudness,
+// updating both the canonical LUFS gauges and the earguard_peak/
+// earguard_avg_peak aliases kept for dashboards built against the
+// original metric names.
+func (s *Server) SetLoudness(momentary, shortTerm float64) {
+	s.MomentaryLUFS.Set(momentary)
+	s.ShortTermLUFS.Set(shortTerm)
+	s.Peak.Set(momentary)
+	s.AvgPeak.Set(shortTerm)
+}
+
+// Publish records event to every open /events stream and returns
+// immediately; a subscriber whose buffer is full misses this event
+// rather than blocking the caller.
+func (s *Server) Publish(event Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for ch := range s.subscribers {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+func (s *Server) subscribe() chan Event {
+	ch := make(chan Event, 16)
+	s.mu.Lock()
+	s.subscribers[ch] = struct{}{}
+	s.mu.Unlock()
+	return ch
+}
+
+func (s *Server) unsubscribe(ch chan Event) {
+	s.mu.Lock()
+	delete(s.subscribers, ch)
+	s.mu.Unlock()
+}
+
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	ch := s.subscribe()
+	defer s.unsubscribe(ch)
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event := <-ch:
+			data, err := json.Marshal(event)
+			if err != nil {
+				continue
+			}
+			w.Write([]byte("data: "))
+			w.Write(data)
+			w.Write([]byte("\n\n"))
+			flusher.Flush()
+		}
+	}
+}
+
+// ListenAndServe exposes /metrics (Prometheus) and /events (SSE) on
+// addr. It blocks, so callers typically run it in its own goroutine.
+func (s *Server) ListenAndServe(addr string) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(s.registry, promhttp.HandlerOpts{}))
+	mux.HandleFunc("/events", s.handleEvents)
+	return http.ListenAndServe(addr, mux)
+}
@@ -0,0 +1,131 @@
+package monitor
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Config holds every tunable for a Runner: trigger thresholds, the
+// volume envelope, per-session ducking, and the global hotkeys used to
+// drive it from the tray.
+type Config struct {
+	Threshold      float64 `json:"threshold"`
+	DivisionFactor float64 `json:"division_factor"`
+	RestoreDelay   int     `json:"restore_delay"`
+	Verbose        bool    `json:"verbose"`
+	SampleWindow   int     `json:"sample_window"`
+
+	// MomentaryThresholdLUFS and ShortTermThresholdLUFS drive triggering
+	// off perceptually-weighted loudness (EBU R128) instead of raw peak.
+	// A zero value disables the corresponding window.
+	MomentaryThresholdLUFS float64 `json:"momentary_threshold_lufs"`
+	ShortTermThresholdLUFS float64 `json:"short_term_threshold_lufs"`
+
+	// TruePeakThresholdDB is a safety trigger for clipping-level
+	// transients, measured on 4x oversampled inter-sample peaks.
+	TruePeakThresholdDB float64 `json:"true_peak_threshold_db"`
+
+	// PerSessionDucking ducks only the offending process's audio
+	// session instead of the endpoint's master volume. IncludeProcesses,
+	// if non-empty, restricts ducking to those process names; anything
+	// in ExcludeProcesses is never ducked.
+	PerSessionDucking bool     `json:"per_session_ducking"`
+	IncludeProcesses  []string `json:"include_processes"`
+	ExcludeProcesses  []string `json:"exclude_processes"`
+
+	// AttackMs/ReleaseMs/HoldMs and Curve control the volume envelope
+	// used when ducking and restoring, instead of an instant jump.
+	// Curve is one of "linear", "exponential", or "equal-power".
+	AttackMs  int    `json:"attack_ms"`
+	ReleaseMs int    `json:"release_ms"`
+	HoldMs    int    `json:"hold_ms"`
+	Curve     string `json:"curve"`
+
+	// HotkeyToggle pauses/resumes monitoring; HotkeyPanicRestore
+	// immediately restores volume, bypassing the release envelope.
+	// Both are "+"-separated combos parsed by the tray package, e.g.
+	// "ctrl+alt+e".
+	HotkeyToggle       string `json:"hotkey_toggle"`
+	HotkeyPanicRestore string `json:"hotkey_panic_restore"`
+
+	// CaptureEnabled dumps the audio around each loud event to a WAV
+	// file for post-mortem review. CaptureLeadSeconds/TrailSeconds set
+	// how much audio is kept before/after the trigger, CaptureDir is
+	// where files are written, and CaptureMaxFiles bounds how many are
+	// kept (oldest deleted first).
+	CaptureEnabled      bool    `json:"capture_enabled"`
+	CaptureLeadSeconds  float64 `json:"capture_lead_seconds"`
+	CaptureTrailSeconds float64 `json:"capture_trail_seconds"`
+	CaptureDir          string  `json:"capture_dir"`
+	CaptureMaxFiles     int     `json:"capture_max_files"`
+
+	// MetricsAddr, if set (e.g. ":9090"), serves Prometheus metrics at
+	// /metrics and a Server-Sent Events stream of duck/restore events
+	// at /events.
+	MetricsAddr string `json:"metrics_addr"`
+}
+
+var DefaultConfig = Config{
+	Threshold:              0.4,
+	DivisionFactor:         4.0,
+	RestoreDelay:           3,
+	Verbose:                false,
+	SampleWindow:           5,
+	MomentaryThresholdLUFS: -14,
+	ShortTermThresholdLUFS: -18,
+	TruePeakThresholdDB:    -1,
+	AttackMs:               50,
+	ReleaseMs:              400,
+	HoldMs:                 0,
+	Curve:                  "equal-power",
+	HotkeyToggle:           "ctrl+alt+e",
+	HotkeyPanicRestore:     "ctrl+alt+r",
+	CaptureEnabled:         false,
+	CaptureLeadSeconds:     5,
+	CaptureTrailSeconds:    5,
+	CaptureDir:             "captures",
+	CaptureMaxFiles:        20,
+}
+
+// LoadConfig reads Config as JSON from filePath, writing out
+// DefaultConfig as a starting point if the file doesn't exist yet. An
+// empty filePath resolves to config.json next to the running
+// executable.
+func LoadConfig(filePath string) (Config, error) {
+	config := DefaultConfig
+
+	if filePath == "" {
+		execPath, err := os.Executable()
+		if err != nil {
+			return config, fmt.Errorf("failed to get executable path: %v", err)
+		}
+		filePath = filepath.Join(filepath.Dir(execPath), "config.json")
+	}
+
+	if _, err := os.Stat(filePath); os.IsNotExist(err) {
+		configData, err := json.MarshalIndent(config, "", "  ")
+		if err != nil {
+			return config, fmt.Errorf("failed to marshal default config: %v", err)
+		}
+		if err := os.WriteFile(filePath, configData, 0644); err != nil {
+			return config, fmt.Errorf("failed to write default config file: %v", err)
+		}
+		fmt.Printf("[%s] Created default configuration file at: %s\n", time.Now().Format("15:04:05"), filePath)
+		return config, nil
+	}
+
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return config, fmt.Errorf("failed to read config file: %v", err)
+	}
+
+	if err := json.Unmarshal(data, &config); err != nil {
+		return config, fmt.Errorf("failed to parse config file: %v", err)
+	}
+
+	fmt.Printf("[%s] Loaded configuration from: %s\n", time.Now().Format("15:04:05"), filePath)
+	return config, nil
+}
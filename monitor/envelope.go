@@ -0,0 +1,119 @@
+package monitor
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// Curve selects the interpolation shape used when ramping volume
+// between two levels.
+type Curve string
+
+const (
+	CurveLinear      Curve = "linear"
+	CurveExponential Curve = "exponential"
+	CurveEqualPower  Curve = "equal-power"
+)
+
+const rampStep = 10 * time.Millisecond
+
+// volumeRamper replaces an instant SetMasterVolumeLevelScalar jump with
+// a compressor-style envelope: ramps are driven by a dedicated
+// goroutine on a time.Ticker so the sampling loop never blocks on
+// them, and a new target arriving mid-ramp cancels and retargets the
+// in-flight one instead of queuing behind it.
+type volumeRamper struct {
+	setVolume func(float32) error
+	getVolume func() (float32, error)
+
+	mu     sync.Mutex
+	cancel chan struct{}
+}
+
+func newVolumeRamper(setVolume func(float32) error, getVolume func() (float32, error)) *volumeRamper {
+	return &volumeRamper{setVolume: setVolume, getVolume: getVolume}
+}
+
+// RampTo smoothly transitions from the current volume to target over
+// duration using curve, running asynchronously. Calling it again
+// before the previous ramp finishes cancels that ramp and starts a new
+// one from wherever the volume currently sits. If onDone is non-nil,
+// it's called (from the ramp goroutine) once target is actually
+// reached; it is not called if the ramp is cancelled by a later
+// RampTo, so callers can use it to tell a completed ramp apart from a
+// superseded one.
+func (r *volumeRamper) RampTo(target float32, duration time.Duration, curve Curve, onDone func()) {
+	r.mu.Lock()
+	if r.cancel != nil {
+		close(r.cancel)
+	}
+	cancel := make(chan struct{})
+	r.cancel = cancel
+	r.mu.Unlock()
+
+	go r.run(target, duration, curve, cancel, onDone)
+}
+
+func (r *volumeRamper) run(target float32, duration time.Duration, curve Curve, cancel chan struct{}, onDone func()) {
+	start, err := r.getVolume()
+	if err != nil {
+		return
+	}
+	if duration <= 0 {
+		r.setVolume(target)
+		if onDone != nil {
+			onDone()
+		}
+		return
+	}
+
+	ticker := time.NewTicker(rampStep)
+	defer ticker.Stop()
+
+	startTime := time.Now()
+	for {
+		select {
+		case <-cancel:
+			return
+		case <-ticker.C:
+			elapsed := time.Since(startTime)
+			t := float64(elapsed) / float64(duration)
+			if t >= 1 {
+				r.setVolume(target)
+				if onDone != nil {
+					onDone()
+				}
+				return
+			}
+			r.setVolume(interpolate(start, target, t, curve))
+		}
+	}
+}
+
+// interpolate returns the volume scalar at position t (0..1) between
+// from and to, shaped by curve.
+func interpolate(from, to float32, t float64, curve Curve) float32 {
+	switch curve {
+	case CurveExponential:
+		fromDB, toDB := scalarToDB(from), scalarToDB(to)
+		return dbToScalar(fromDB + (toDB-fromDB)*t)
+	case CurveEqualPower:
+		gainFrom := math.Cos(t * math.Pi / 2)
+		gainTo := math.Sin(t * math.Pi / 2)
+		return float32(float64(from)*gainFrom + float64(to)*gainTo)
+	default: // CurveLinear
+		return from + (to-from)*float32(t)
+	}
+}
+
+func scalarToDB(scalar float32) float64 {
+	if scalar <= 0 {
+		return -120 // floor for silence, avoids -Inf propagating through the ramp
+	}
+	return 20 * math.Log10(float64(scalar))
+}
+
+func dbToScalar(db float64) float32 {
+	return float32(math.Pow(10, db/20))
+}
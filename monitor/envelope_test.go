@@ -0,0 +1,100 @@
+package monitor
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestInterpolateLinear(t *testing.T) {
+	if got := interpolate(0, 1, 0.5, CurveLinear); got != 0.5 {
+		t.Errorf("interpolate(0, 1, 0.5, linear) = %v, want 0.5", got)
+	}
+	if got := interpolate(0.2, 0.8, 0, CurveLinear); got != 0.2 {
+		t.Errorf("interpolate(t=0) = %v, want from (0.2)", got)
+	}
+	if got := interpolate(0.2, 0.8, 1, CurveLinear); got != 0.8 {
+		t.Errorf("interpolate(t=1) = %v, want to (0.8)", got)
+	}
+}
+
+func TestInterpolateEqualPower(t *testing.T) {
+	if got := interpolate(1, 0, 0, CurveEqualPower); math.Abs(float64(got-1)) > 1e-6 {
+		t.Errorf("interpolate(t=0, equal-power) = %v, want 1", got)
+	}
+	if got := interpolate(1, 0, 1, CurveEqualPower); math.Abs(float64(got)) > 1e-6 {
+		t.Errorf("interpolate(t=1, equal-power) = %v, want 0", got)
+	}
+}
+
+func TestInterpolateExponential(t *testing.T) {
+	if got := interpolate(0.5, 0.5, 0.5, CurveExponential); math.Abs(float64(got-0.5)) > 1e-6 {
+		t.Errorf("interpolate(from==to, exponential) = %v, want 0.5", got)
+	}
+
+	from, to := float32(1.0), float32(0.1)
+	got := interpolate(from, to, 1, CurveExponential)
+	if math.Abs(float64(got-to)) > 1e-4 {
+		t.Errorf("interpolate(t=1, exponential) = %v, want %v", got, to)
+	}
+}
+
+func TestScalarToDBFloor(t *testing.T) {
+	if got := scalarToDB(0); got != -120 {
+		t.Errorf("scalarToDB(0) = %v, want -120", got)
+	}
+	if got := scalarToDB(-1); got != -120 {
+		t.Errorf("scalarToDB(-1) = %v, want -120", got)
+	}
+}
+
+func TestScalarToDBAndBackRoundTrip(t *testing.T) {
+	for _, scalar := range []float32{1.0, 0.5, 0.1, 0.01} {
+		db := scalarToDB(scalar)
+		got := dbToScalar(db)
+		if math.Abs(float64(got-scalar)) > 1e-4 {
+			t.Errorf("dbToScalar(scalarToDB(%v)) = %v, want %v", scalar, got, scalar)
+		}
+	}
+}
+
+func TestDbToScalarUnityGain(t *testing.T) {
+	if got := dbToScalar(0); math.Abs(float64(got-1)) > 1e-6 {
+		t.Errorf("dbToScalar(0) = %v, want 1", got)
+	}
+}
+
+func TestVolumeRamperRampToCallsOnDoneWhenComplete(t *testing.T) {
+	var current float32 = 1.0
+	r := newVolumeRamper(
+		func(v float32) error { current = v; return nil },
+		func() (float32, error) { return current, nil },
+	)
+
+	done := make(chan struct{})
+	r.RampTo(0.5, 20*time.Millisecond, CurveLinear, func() { close(done) })
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("onDone was not called after the ramp completed")
+	}
+}
+
+func TestVolumeRamperRampToSkipsOnDoneWhenSuperseded(t *testing.T) {
+	var current float32 = 1.0
+	r := newVolumeRamper(
+		func(v float32) error { current = v; return nil },
+		func() (float32, error) { return current, nil },
+	)
+
+	called := make(chan struct{}, 1)
+	r.RampTo(0.5, time.Second, CurveLinear, func() { called <- struct{}{} })
+	r.RampTo(0.8, 20*time.Millisecond, CurveLinear, nil)
+
+	select {
+	case <-called:
+		t.Fatal("onDone of the superseded ramp was called")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
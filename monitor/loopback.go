@@ -0,0 +1,159 @@
+package monitor
+
+import (
+	"fmt"
+	"time"
+	"unsafe"
+
+	"github.com/go-ole/go-ole"
+	"github.com/moutend/go-wca/pkg/wca"
+
+	"github.com/Adolanium/earguard/loudness"
+)
+
+// loopbackCapture owns the WASAPI loopback stream used to feed a
+// loudness.Meter with the audio actually being rendered to the default
+// endpoint, rather than relying on IAudioMeterInformation's coarse peak.
+type loopbackCapture struct {
+	audioClient   *wca.IAudioClient
+	captureClient *wca.IAudioCaptureClient
+	event         uintptr
+	waveFormat    *wca.WAVEFORMATEX
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// startLoopbackCapture activates the device in shared, event-driven
+// loopback mode and returns a handle the caller must stop with Close.
+func startLoopbackCapture(device *wca.IMMDevice) (*loopbackCapture, error) {
+	var audioClient *wca.IAudioClient
+	if err := device.Activate(wca.IID_IAudioClient, wca.CLSCTX_ALL, nil, &audioClient); err != nil {
+		return nil, fmt.Errorf("failed to activate audio client: %v", err)
+	}
+
+	var waveFormat *wca.WAVEFORMATEX
+	if err := audioClient.GetMixFormat(&waveFormat); err != nil {
+		audioClient.Release()
+		return nil, fmt.Errorf("failed to get mix format: %v", err)
+	}
+
+	const bufferDuration = 2 * time.Second // converted to REFERENCE_TIME (100ns units) below
+	if err := audioClient.Initialize(
+		wca.AUDCLNT_SHAREMODE_SHARED,
+		wca.AUDCLNT_STREAMFLAGS_LOOPBACK|wca.AUDCLNT_STREAMFLAGS_EVENTCALLBACK,
+		wca.REFERENCE_TIME(bufferDuration/100),
+		0,
+		waveFormat,
+		nil,
+	); err != nil {
+		audioClient.Release()
+		return nil, fmt.Errorf("failed to initialize loopback client: %v", err)
+	}
+
+	event := wca.CreateEventExA(0, 0, 0, 0)
+	if event == 0 {
+		audioClient.Release()
+		return nil, fmt.Errorf("failed to create capture event")
+	}
+	if err := audioClient.SetEventHandle(event); err != nil {
+		audioClient.Release()
+		return nil, fmt.Errorf("failed to set event handle: %v", err)
+	}
+
+	var captureClient *wca.IAudioCaptureClient
+	if err := audioClient.GetService(wca.IID_IAudioCaptureClient, &captureClient); err != nil {
+		audioClient.Release()
+		return nil, fmt.Errorf("failed to get capture client: %v", err)
+	}
+
+	if err := audioClient.Start(); err != nil {
+		captureClient.Release()
+		audioClient.Release()
+		return nil, fmt.Errorf("failed to start loopback capture: %v", err)
+	}
+
+	return &loopbackCapture{
+		audioClient:   audioClient,
+		captureClient: captureClient,
+		event:         event,
+		waveFormat:    waveFormat,
+		stop:          make(chan struct{}),
+		done:          make(chan struct{}),
+	}, nil
+}
+
+// Run feeds captured blocks into meter until Close is called. It
+// signals done on return so Close can wait for it before releasing the
+// underlying COM objects, since Run may still be blocked in
+// WaitForSingleObject or mid-GetBuffer when Close is requested.
+func (c *loopbackCapture) Run(meter *loudness.Meter) {
+	defer close(c.done)
+	channels := int(c.waveFormat.NChannels)
+
+	for {
+		select {
+		case <-c.stop:
+			return
+		default:
+		}
+
+		if res := wca.WaitForSingleObject(c.event, 200); res != 0 {
+			continue
+		}
+
+		var packetLength uint32
+		if err := c.captureClient.GetNextPacketSize(&packetLength); err != nil {
+			continue
+		}
+
+		for packetLength != 0 {
+			var data *byte
+			var numFrames uint32
+			var flags uint32
+			if err := c.captureClient.GetBuffer(&data, &numFrames, &flags, nil, nil); err != nil {
+				break
+			}
+
+			perChannel := deinterleaveFloat32(data, int(numFrames), channels)
+			meter.AddSamples(perChannel)
+
+			if err := c.captureClient.ReleaseBuffer(numFrames); err != nil {
+				break
+			}
+			if err := c.captureClient.GetNextPacketSize(&packetLength); err != nil {
+				break
+			}
+		}
+	}
+}
+
+// deinterleaveFloat32 splits an interleaved IEEE-float PCM buffer (the
+// format WASAPI loopback endpoints use almost universally) into one
+// slice per channel.
+func deinterleaveFloat32(data *byte, numFrames, channels int) [][]float32 {
+	src := (*(*[1 << 28]float32)(unsafe.Pointer(data)))[: numFrames*channels : numFrames*channels]
+
+	out := make([][]float32, channels)
+	for ch := range out {
+		out[ch] = make([]float32, numFrames)
+	}
+	for i := 0; i < numFrames; i++ {
+		for ch := 0; ch < channels; ch++ {
+			out[ch][i] = src[i*channels+ch]
+		}
+	}
+	return out
+}
+
+// Close stops Run, waits for it to return, and releases the underlying
+// COM objects. It must not be called before Run has started.
+func (c *loopbackCapture) Close() {
+	close(c.stop)
+	<-c.done
+	c.audioClient.Stop()
+	c.captureClient.Release()
+	c.audioClient.Release()
+	wca.CloseHandle(c.event)
+	ole.CoTaskMemFree(uintptr(unsafe.Pointer(c.waveFormat)))
+}
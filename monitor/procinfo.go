@@ -0,0 +1,46 @@
+package monitor
+
+import (
+	"path/filepath"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	modkernel32                   = syscall.NewLazyDLL("kernel32.dll")
+	procOpenProcess               = modkernel32.NewProc("OpenProcess")
+	procQueryFullProcessImageName = modkernel32.NewProc("QueryFullProcessImageNameW")
+	procCloseHandle               = modkernel32.NewProc("CloseHandle")
+)
+
+const processQueryLimitedInformation = 0x1000
+
+// processNameForPID resolves a PID to its executable's base name (e.g.
+// "chrome.exe"). It returns an empty string if the process can't be
+// inspected, which happens for protected system processes; callers
+// treat that the same as "unknown" rather than failing.
+func processNameForPID(pid uint32) string {
+	if pid == 0 {
+		return ""
+	}
+
+	handle, _, _ := procOpenProcess.Call(processQueryLimitedInformation, 0, uintptr(pid))
+	if handle == 0 {
+		return ""
+	}
+	defer procCloseHandle.Call(handle)
+
+	buf := make([]uint16, syscall.MAX_PATH)
+	size := uint32(len(buf))
+	ret, _, _ := procQueryFullProcessImageName.Call(
+		handle,
+		0,
+		uintptr(unsafe.Pointer(&buf[0])),
+		uintptr(unsafe.Pointer(&size)),
+	)
+	if ret == 0 {
+		return ""
+	}
+
+	return filepath.Base(syscall.UTF16ToString(buf[:size]))
+}
@@ -0,0 +1,402 @@
+package monitor
+
+import (
+	"fmt"
+	"log"
+	"log/slog"
+	"math"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-ole/go-ole"
+	"github.com/moutend/go-wca/pkg/wca"
+
+	"github.com/Adolanium/earguard/capture"
+	"github.com/Adolanium/earguard/loudness"
+	"github.com/Adolanium/earguard/metrics"
+)
+
+// State describes what a Runner is currently doing. It's broadcast on
+// the channel returned by States so a tray icon or other UI can reflect
+// it without polling.
+type State int
+
+const (
+	StateStopped State = iota
+	StateRunning
+	StatePaused
+)
+
+// Runner owns the full audio-monitoring loop: COM setup, loopback
+// capture, loudness metering, and volume ducking/restoring. It used to
+// be main's for-loop directly; it was pulled out so a tray goroutine
+// and the audio goroutine can coordinate through Start/Stop/Pause
+// instead of sharing package-level state.
+type Runner struct {
+	config Config
+
+	// thresholdBits is config.MomentaryThresholdLUFS, accessed
+	// atomically as math.Float64bits so AdjustThreshold (called from
+	// the tray/hotkey goroutine) and Start's loop (which reads it
+	// every iteration) don't race.
+	thresholdBits uint64
+
+	paused   int32 // atomic bool
+	stop     chan struct{}
+	stopOnce sync.Once
+	states   chan State
+	restore  chan struct{} // panic-restore request
+}
+
+// eventLogger is a JSON structured logger for duck/restore events, so
+// they can be parsed by log aggregators instead of scraped from plain
+// text.
+var eventLogger = slog.New(slog.NewJSONHandler(os.Stdout, nil))
+
+// NewRunner creates a Runner for config. Call Start to begin
+// monitoring.
+func NewRunner(config Config) *Runner {
+	return &Runner{
+		config:        config,
+		thresholdBits: math.Float64bits(config.MomentaryThresholdLUFS),
+		stop:          make(chan struct{}),
+		states:        make(chan State, 8),
+		restore:       make(chan struct{}, 1),
+	}
+}
+
+// threshold returns the current momentary LUFS threshold.
+func (r *Runner) threshold() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&r.thresholdBits))
+}
+
+// States returns a channel of state transitions (Running/Paused/
+// Stopped). Sends are best-effort: a slow reader may miss intermediate
+// states but will always see the most recent one eventually.
+func (r *Runner) States() <-chan State {
+	return r.states
+}
+
+func (r *Runner) emit(s State) {
+	for {
+		select {
+		case r.states <- s:
+			return
+		default:
+		}
+		// Buffer full: drop the oldest state so the newest still lands.
+		select {
+		case <-r.states:
+		default:
+		}
+	}
+}
+
+// Pause suspends ducking decisions without tearing down COM objects or
+// the capture stream, so Resume is cheap.
+func (r *Runner) Pause() {
+	atomic.StoreInt32(&r.paused, 1)
+	r.emit(StatePaused)
+}
+
+// Resume un-suspends a paused Runner.
+func (r *Runner) Resume() {
+	atomic.StoreInt32(&r.paused, 0)
+	r.emit(StateRunning)
+}
+
+// TogglePause flips between Pause and Resume.
+func (r *Runner) TogglePause() {
+	if atomic.LoadInt32(&r.paused) == 1 {
+		r.Resume()
+	} else {
+		r.Pause()
+	}
+}
+
+// RestoreNow asks the running loop to immediately restore volume,
+// bypassing the release envelope. It's a no-op if nothing is ducked.
+func (r *Runner) RestoreNow() {
+	select {
+	case r.restore <- struct{}{}:
+	default:
+	}
+}
+
+// AdjustThreshold nudges the momentary LUFS threshold by delta (in LU).
+// Positive delta makes EarGuard less sensitive.
+func (r *Runner) AdjustThreshold(delta float64) {
+	for {
+		old := atomic.LoadUint64(&r.thresholdBits)
+		next := math.Float64bits(math.Float64frombits(old) + delta)
+		if atomic.CompareAndSwapUint64(&r.thresholdBits, old, next) {
+			return
+		}
+	}
+}
+
+// Stop signals the monitoring loop to end and returns without waiting;
+// Start then restores any ducked volume, releases all COM objects and
+// returns. Start must not be called again on the same Runner afterward.
+func (r *Runner) Stop() {
+	r.stopOnce.Do(func() { close(r.stop) })
+}
+
+// Start initializes COM and the audio stack and runs the monitoring
+// loop until Stop is called. It blocks, so callers typically run it in
+// its own goroutine.
+func (r *Runner) Start() error {
+	if err := ole.CoInitializeEx(0, ole.COINIT_APARTMENTTHREADED); err != nil {
+		return fmt.Errorf("failed to initialize COM: %v", err)
+	}
+	defer ole.CoUninitialize()
+
+	var deviceEnumerator *wca.IMMDeviceEnumerator
+	if err := wca.CoCreateInstance(
+		wca.CLSID_MMDeviceEnumerator,
+		0,
+		wca.CLSCTX_ALL,
+		wca.IID_IMMDeviceEnumerator,
+		&deviceEnumerator,
+	); err != nil {
+		return fmt.Errorf("failed to create device enumerator: %v", err)
+	}
+	defer deviceEnumerator.Release()
+
+	var device *wca.IMMDevice
+	if err := deviceEnumerator.GetDefaultAudioEndpoint(wca.ERender, wca.EConsole, &device); err != nil {
+		return fmt.Errorf("failed to get default audio endpoint: %v", err)
+	}
+	defer device.Release()
+
+	var audioEndpointVolume *wca.IAudioEndpointVolume
+	if err := device.Activate(wca.IID_IAudioEndpointVolume, wca.CLSCTX_ALL, nil, &audioEndpointVolume); err != nil {
+		return fmt.Errorf("failed to activate audio endpoint volume: %v", err)
+	}
+	defer audioEndpointVolume.Release()
+
+	loopback, err := startLoopbackCapture(device)
+	if err != nil {
+		return fmt.Errorf("failed to start loopback capture: %v", err)
+	}
+	defer loopback.Close()
+
+	meter := loudness.New(float64(loopback.waveFormat.NSamplesPerSec), int(loopback.waveFormat.NChannels), nil)
+	go loopback.Run(meter)
+
+	var ducker *sessionDucker
+	if r.config.PerSessionDucking {
+		ducker, err = newSessionDucker(device, r.config.IncludeProcesses, r.config.ExcludeProcesses)
+		if err != nil {
+			return fmt.Errorf("failed to start per-session ducking: %v", err)
+		}
+		defer ducker.Close()
+	}
+
+	var recorder *capture.Recorder
+	if r.config.CaptureEnabled {
+		recorder, err = capture.New(device, capture.Config{
+			LeadSeconds:  r.config.CaptureLeadSeconds,
+			TrailSeconds: r.config.CaptureTrailSeconds,
+			Dir:          r.config.CaptureDir,
+			MaxFiles:     r.config.CaptureMaxFiles,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to start event capture: %v", err)
+		}
+		defer recorder.Close()
+		go recorder.Run()
+	}
+
+	var metricsServer *metrics.Server
+	if r.config.MetricsAddr != "" {
+		metricsServer = metrics.New()
+		go func() {
+			if err := metricsServer.ListenAndServe(r.config.MetricsAddr); err != nil {
+				log.Printf("[%s] Metrics server stopped: %v", time.Now().Format("15:04:05"), err)
+			}
+		}()
+	}
+
+	curve := Curve(r.config.Curve)
+	ramper := newVolumeRamper(
+		func(v float32) error { return audioEndpointVolume.SetMasterVolumeLevelScalar(v, nil) },
+		func() (float32, error) {
+			var v float32
+			err := audioEndpointVolume.GetMasterVolumeLevelScalar(&v)
+			return v, err
+		},
+	)
+
+	r.emit(StateRunning)
+	log.Printf("[%s] Audio monitoring active", time.Now().Format("15:04:05"))
+
+	var isReducedVolume bool
+	var originalVolume float32
+	var lastLoudTimestamp time.Time
+	var duckStart time.Time
+	var lastPrintTime = time.Now()
+
+	// releasing is set while a release ramp toward originalVolume is
+	// in flight and cleared by its onDone callback (from the ramper's
+	// goroutine, hence atomic). A new loud event arriving mid-release
+	// checks it before re-deriving originalVolume from the live
+	// scalar, which mid-ramp would just be a partially-restored level.
+	var releasing int32
+
+	for {
+		select {
+		case <-r.stop:
+			if isReducedVolume {
+				audioEndpointVolume.SetMasterVolumeLevelScalar(originalVolume, nil)
+			}
+			if ducker != nil {
+				if err := ducker.RestoreAll(); err != nil {
+					log.Printf("[%s] Error restoring ducked sessions: %v", time.Now().Format("15:04:05"), err)
+				}
+			}
+			r.emit(StateStopped)
+			return nil
+		case <-r.restore:
+			if isReducedVolume {
+				audioEndpointVolume.SetMasterVolumeLevelScalar(originalVolume, nil)
+				isReducedVolume = false
+				log.Printf("[%s] Panic restore: volume set back to %.0f%%", time.Now().Format("15:04:05"), originalVolume*100)
+			}
+			if ducker != nil {
+				if err := ducker.RestoreAll(); err != nil {
+					log.Printf("[%s] Error restoring ducked sessions: %v", time.Now().Format("15:04:05"), err)
+				} else {
+					log.Printf("[%s] Panic restore: ducked sessions restored", time.Now().Format("15:04:05"))
+				}
+			}
+		default:
+		}
+
+		if atomic.LoadInt32(&r.paused) == 1 {
+			time.Sleep(100 * time.Millisecond)
+			continue
+		}
+
+		momentary := meter.Momentary()
+		shortTerm := meter.ShortTerm()
+		truePeakDB := meter.TruePeakDB()
+		meter.ResetTruePeak()
+
+		threshold := r.threshold()
+		isLoud := (threshold != 0 && momentary > threshold) ||
+			(r.config.ShortTermThresholdLUFS != 0 && shortTerm > r.config.ShortTermThresholdLUFS) ||
+			(r.config.TruePeakThresholdDB != 0 && truePeakDB > r.config.TruePeakThresholdDB)
+
+		if metricsServer != nil {
+			metricsServer.SetLoudness(momentary, shortTerm)
+		}
+
+		var currentVolume float32
+		if err := audioEndpointVolume.GetMasterVolumeLevelScalar(&currentVolume); err != nil {
+			time.Sleep(100 * time.Millisecond)
+			continue
+		}
+
+		if metricsServer != nil {
+			metricsServer.CurrentVolume.Set(float64(currentVolume))
+		}
+
+		if r.config.PerSessionDucking {
+			duckLoudSessions(ducker, r.config, metricsServer, recorder)
+			if metricsServer != nil {
+				if ducker.AnyDucked() {
+					metricsServer.Reduced.Set(1)
+				} else {
+					metricsServer.Reduced.Set(0)
+				}
+			}
+			time.Sleep(50 * time.Millisecond)
+			continue
+		}
+
+		if metricsServer != nil {
+			if isReducedVolume {
+				metricsServer.Reduced.Set(1)
+			} else {
+				metricsServer.Reduced.Set(0)
+			}
+		}
+
+		if r.config.Verbose && time.Since(lastPrintTime) > 2*time.Second {
+			log.Printf("[%s] Momentary: %.1f LUFS, Short-term: %.1f LUFS, True peak: %.1f dBTP, Volume: %.0f%%, Reduced: %v",
+				time.Now().Format("15:04:05"), momentary, shortTerm, truePeakDB, currentVolume*100, isReducedVolume)
+			lastPrintTime = time.Now()
+		}
+
+		if isLoud && !isReducedVolume {
+			if atomic.LoadInt32(&releasing) == 0 {
+				originalVolume = currentVolume
+			}
+			atomic.StoreInt32(&releasing, 0) // superseded by this new duck
+			newVolume := originalVolume / float32(r.config.DivisionFactor)
+			ramper.RampTo(newVolume, time.Duration(r.config.AttackMs)*time.Millisecond, curve, nil)
+			isReducedVolume = true
+			lastLoudTimestamp = time.Now()
+			duckStart = time.Now()
+
+			eventLogger.Info("duck",
+				"timestamp", time.Now(),
+				"momentary_lufs", momentary,
+				"short_term_lufs", shortTerm,
+				"true_peak_db", truePeakDB,
+				"threshold_lufs", threshold,
+				"original_volume", originalVolume,
+				"new_volume", newVolume,
+			)
+			if metricsServer != nil {
+				metricsServer.DucksTotal.Inc()
+				metricsServer.Publish(metrics.Event{
+					Timestamp:      time.Now(),
+					Kind:           "duck",
+					Peak:           momentary,
+					Threshold:      threshold,
+					OriginalVolume: originalVolume,
+					NewVolume:      newVolume,
+				})
+			}
+
+			if recorder != nil {
+				go func(peakDB float64) {
+					if err := recorder.Trigger(peakDB); err != nil {
+						log.Printf("[%s] Error writing event capture: %v", time.Now().Format("15:04:05"), err)
+					}
+				}(truePeakDB)
+			}
+		} else if isLoud && isReducedVolume {
+			lastLoudTimestamp = time.Now()
+		} else if isReducedVolume &&
+			time.Since(lastLoudTimestamp) > time.Duration(r.config.RestoreDelay)*time.Second &&
+			time.Since(duckStart) > time.Duration(r.config.HoldMs)*time.Millisecond {
+			atomic.StoreInt32(&releasing, 1)
+			ramper.RampTo(originalVolume, time.Duration(r.config.ReleaseMs)*time.Millisecond, curve, func() {
+				atomic.StoreInt32(&releasing, 0)
+			})
+			isReducedVolume = false
+
+			eventLogger.Info("restore",
+				"timestamp", time.Now(),
+				"restored_volume", originalVolume,
+				"duck_duration_seconds", time.Since(duckStart).Seconds(),
+			)
+			if metricsServer != nil {
+				metricsServer.DuckDurationSeconds.Observe(time.Since(duckStart).Seconds())
+				metricsServer.Publish(metrics.Event{
+					Timestamp:      time.Now(),
+					Kind:           "restore",
+					OriginalVolume: originalVolume,
+					NewVolume:      originalVolume,
+				})
+			}
+		}
+
+		time.Sleep(50 * time.Millisecond)
+	}
+}
@@ -0,0 +1,319 @@
+package monitor
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/moutend/go-wca/pkg/wca"
+
+	"github.com/Adolanium/earguard/capture"
+	"github.com/Adolanium/earguard/metrics"
+)
+
+// sessionDucker ducks individual audio sessions (one per running
+// process that is rendering audio) instead of the whole endpoint's
+// master volume, so a noisy browser tab or game can be turned down
+// without muffling a simultaneous voice call.
+type sessionDucker struct {
+	sessionManager *wca.IAudioSessionManager2
+	include        map[string]bool
+	exclude        map[string]bool
+
+	// original holds each ducked session's pre-duck volume, keyed by PID,
+	// so it can be restored once that session quiets down.
+	original map[uint32]float32
+
+	// lastLoud tracks when each PID was last seen over threshold, so a
+	// duck can be held for RestoreDelay after the session quiets down.
+	lastLoud map[uint32]time.Time
+
+	// duckStart records when each PID was first ducked, so the duck
+	// duration histogram observes the real span instead of lastLoud
+	// (which keeps getting refreshed while the session stays loud).
+	duckStart map[uint32]time.Time
+}
+
+// newSessionDucker activates IAudioSessionManager2 on device and builds
+// the include/exclude process filters from config.
+func newSessionDucker(device *wca.IMMDevice, include, exclude []string) (*sessionDucker, error) {
+	var sessionManager *wca.IAudioSessionManager2
+	if err := device.Activate(wca.IID_IAudioSessionManager2, wca.CLSCTX_ALL, nil, &sessionManager); err != nil {
+		return nil, fmt.Errorf("failed to activate session manager: %v", err)
+	}
+
+	return &sessionDucker{
+		sessionManager: sessionManager,
+		include:        toLowerSet(include),
+		exclude:        toLowerSet(exclude),
+		original:       make(map[uint32]float32),
+		lastLoud:       make(map[uint32]time.Time),
+		duckStart:      make(map[uint32]time.Time),
+	}, nil
+}
+
+func toLowerSet(names []string) map[string]bool {
+	set := make(map[string]bool, len(names))
+	for _, n := range names {
+		set[strings.ToLower(n)] = true
+	}
+	return set
+}
+
+// sessionPeak describes one enumerated audio session's current state.
+type sessionPeak struct {
+	pid     uint32
+	process string
+	peak    float32
+	volume  *wca.ISimpleAudioVolume
+}
+
+// Peaks enumerates active audio sessions and returns their PID,
+// process name, and current peak, filtered by include/exclude.
+func (d *sessionDucker) Peaks() ([]sessionPeak, error) {
+	var enumerator *wca.IAudioSessionEnumerator
+	if err := d.sessionManager.GetSessionEnumerator(&enumerator); err != nil {
+		return nil, fmt.Errorf("failed to get session enumerator: %v", err)
+	}
+	defer enumerator.Release()
+
+	var count int
+	if err := enumerator.GetCount(&count); err != nil {
+		return nil, fmt.Errorf("failed to get session count: %v", err)
+	}
+
+	var peaks []sessionPeak
+	for i := 0; i < count; i++ {
+		var control *wca.IAudioSessionControl
+		if err := enumerator.GetSession(i, &control); err != nil {
+			continue
+		}
+
+		peak, err := d.inspectSession(control)
+		control.Release()
+		if err != nil {
+			continue
+		}
+		if peak == nil {
+			continue
+		}
+		if d.skip(peak.process) {
+			peak.volume.Release()
+			continue
+		}
+		peaks = append(peaks, *peak)
+	}
+	return peaks, nil
+}
+
+func (d *sessionDucker) inspectSession(control *wca.IAudioSessionControl) (*sessionPeak, error) {
+	var control2 *wca.IAudioSessionControl2
+	if err := control.PutQueryInterface(wca.IID_IAudioSessionControl2, &control2); err != nil {
+		return nil, err
+	}
+	defer control2.Release()
+
+	var pid uint32
+	if err := control2.GetProcessId(&pid); err != nil {
+		return nil, err
+	}
+
+	var meter *wca.IAudioMeterInformation
+	if err := control.PutQueryInterface(wca.IID_IAudioMeterInformation, &meter); err != nil {
+		return nil, err
+	}
+	defer meter.Release()
+
+	var peakValue float32
+	if err := meter.GetPeakValue(&peakValue); err != nil {
+		return nil, err
+	}
+
+	var volume *wca.ISimpleAudioVolume
+	if err := control.PutQueryInterface(wca.IID_ISimpleAudioVolume, &volume); err != nil {
+		return nil, err
+	}
+
+	return &sessionPeak{
+		pid:     pid,
+		process: processNameForPID(pid),
+		peak:    peakValue,
+		volume:  volume,
+	}, nil
+}
+
+// skip reports whether a process should be excluded from ducking: it's
+// on the exclude list, or an include list is set and it's not on it.
+func (d *sessionDucker) skip(process string) bool {
+	name := strings.ToLower(process)
+	if d.exclude[name] {
+		return true
+	}
+	if len(d.include) > 0 && !d.include[name] {
+		return true
+	}
+	return false
+}
+
+// Duck reduces a session's volume by divisionFactor, remembering the
+// original level so Restore can undo it. It returns the original and
+// new volume it actually set, so callers can log or publish the real
+// values instead of re-deriving them. If the session is already
+// ducked, it's a no-op that reports the volume recorded from the
+// first duck.
+func (d *sessionDucker) Duck(p sessionPeak, divisionFactor float64) (original, newVolume float32, err error) {
+	if current, already := d.original[p.pid]; already {
+		return current, current / float32(divisionFactor), nil
+	}
+
+	var current float32
+	if err := p.volume.GetMasterVolume(&current); err != nil {
+		return 0, 0, err
+	}
+	d.original[p.pid] = current
+
+	newVolume = current / float32(divisionFactor)
+	if err := p.volume.SetMasterVolume(newVolume, nil); err != nil {
+		return 0, 0, err
+	}
+	return current, newVolume, nil
+}
+
+// Restore reverts a previously ducked session back to its original
+// volume, if one is on record.
+func (d *sessionDucker) Restore(p sessionPeak) error {
+	original, ok := d.original[p.pid]
+	if !ok {
+		return nil
+	}
+	delete(d.original, p.pid)
+	delete(d.duckStart, p.pid)
+	return p.volume.SetMasterVolume(original, nil)
+}
+
+// RestoreAll restores every currently-ducked session to its original
+// volume, for panic-restore and shutdown: those act on the whole
+// endpoint, so they shouldn't leave a per-session duck in place.
+func (d *sessionDucker) RestoreAll() error {
+	if len(d.original) == 0 {
+		return nil
+	}
+
+	peaks, err := d.Peaks()
+	if err != nil {
+		return fmt.Errorf("failed to enumerate sessions for restore: %v", err)
+	}
+
+	for _, p := range peaks {
+		if _, ducked := d.original[p.pid]; ducked {
+			if err := d.Restore(p); err != nil {
+				eventLogger.Error("restore session failed", "process", p.process, "pid", p.pid, "error", err)
+			}
+		}
+		p.volume.Release()
+	}
+	return nil
+}
+
+// AnyDucked reports whether at least one session is currently ducked,
+// for callers (the Prometheus earguard_reduced gauge) that need a
+// single reduced/not-reduced signal in per-session mode.
+func (d *sessionDucker) AnyDucked() bool {
+	return len(d.original) > 0
+}
+
+// Close releases the session manager.
+func (d *sessionDucker) Close() {
+	d.sessionManager.Release()
+}
+
+// duckLoudSessions polls every active audio session, ducking any whose
+// peak crosses config.Threshold and restoring any that have stayed
+// quiet for config.RestoreDelay seconds. Each duck/restore is emitted
+// as a structured log record and, if metricsServer is non-nil, as a
+// Prometheus counter/histogram update and an /events record. If
+// recorder is non-nil, a fresh duck also triggers a WAV capture, the
+// same as the master-volume ducking path.
+func duckLoudSessions(d *sessionDucker, config Config, metricsServer *metrics.Server, recorder *capture.Recorder) {
+	peaks, err := d.Peaks()
+	if err != nil {
+		eventLogger.Error("enumerate sessions failed", "error", err)
+		return
+	}
+
+	seen := make(map[uint32]bool, len(peaks))
+	for _, p := range peaks {
+		seen[p.pid] = true
+
+		if p.peak > float32(config.Threshold) {
+			d.lastLoud[p.pid] = time.Now()
+			_, alreadyDucked := d.original[p.pid]
+			original, newVolume, err := d.Duck(p, config.DivisionFactor)
+			if err != nil {
+				eventLogger.Error("duck session failed", "process", p.process, "pid", p.pid, "error", err)
+			} else if !alreadyDucked {
+				d.duckStart[p.pid] = time.Now()
+				eventLogger.Info("duck",
+					"timestamp", time.Now(),
+					"process", p.process,
+					"pid", p.pid,
+					"peak", p.peak,
+					"threshold", config.Threshold,
+					"original_volume", original,
+					"new_volume", newVolume,
+				)
+				if metricsServer != nil {
+					metricsServer.DucksTotal.Inc()
+					metricsServer.Publish(metrics.Event{
+						Timestamp:      time.Now(),
+						Kind:           "duck",
+						Peak:           float64(p.peak),
+						Threshold:      config.Threshold,
+						OriginalVolume: original,
+						NewVolume:      newVolume,
+						Process:        p.process,
+					})
+				}
+				if recorder != nil {
+					go func(peakDB float64) {
+						if err := recorder.Trigger(peakDB); err != nil {
+							eventLogger.Error("event capture failed", "error", err)
+						}
+					}(scalarToDB(p.peak))
+				}
+			}
+		} else if original, ducked := d.original[p.pid]; ducked && time.Since(d.lastLoud[p.pid]) > time.Duration(config.RestoreDelay)*time.Second {
+			duckedSince := d.duckStart[p.pid]
+			if err := d.Restore(p); err != nil {
+				eventLogger.Error("restore session failed", "process", p.process, "pid", p.pid, "error", err)
+			} else {
+				eventLogger.Info("restore",
+					"timestamp", time.Now(),
+					"process", p.process,
+					"pid", p.pid,
+					"restored_volume", original,
+				)
+				if metricsServer != nil {
+					metricsServer.DuckDurationSeconds.Observe(time.Since(duckedSince).Seconds())
+					metricsServer.Publish(metrics.Event{
+						Timestamp:      time.Now(),
+						Kind:           "restore",
+						OriginalVolume: original,
+						NewVolume:      original,
+						Process:        p.process,
+					})
+				}
+			}
+		}
+
+		p.volume.Release()
+	}
+
+	for pid := range d.lastLoud {
+		if !seen[pid] {
+			delete(d.lastLoud, pid)
+			delete(d.original, pid)
+			delete(d.duckStart, pid)
+		}
+	}
+}
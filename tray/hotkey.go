@@ -0,0 +1,135 @@
+package tray
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/moutend/go-hook/pkg/types"
+)
+
+// hotkey is a parsed key combo: the trigger key plus the modifier keys
+// that must be held alongside it. go-hook has no combo-matching helper
+// of its own, so Config's "ctrl+alt+e"-style strings are parsed here
+// and matched by hand against held keys in registerHotkeys.
+type hotkey struct {
+	key       types.VKCode
+	modifiers []types.VKCode
+}
+
+// binding pairs a parsed hotkey with the action it triggers. Keeping
+// the pair together (rather than keying a map by trigger VK) lets two
+// bindings share a trigger key with different modifiers, e.g.
+// "ctrl+alt+e" and "ctrl+shift+e", without one clobbering the other.
+type binding struct {
+	hk     hotkey
+	action func()
+}
+
+var modifierKeys = map[string]types.VKCode{
+	"ctrl":  types.VK_CONTROL,
+	"alt":   types.VK_MENU,
+	"shift": types.VK_SHIFT,
+	"win":   types.VK_LWIN,
+}
+
+// namedKeys covers keys that aren't a single letter or digit.
+var namedKeys = map[string]types.VKCode{
+	"space":     types.VK_SPACE,
+	"tab":       types.VK_TAB,
+	"enter":     types.VK_RETURN,
+	"esc":       types.VK_ESCAPE,
+	"escape":    types.VK_ESCAPE,
+	"backspace": types.VK_BACK,
+	"delete":    types.VK_DELETE,
+	"insert":    types.VK_INSERT,
+	"home":      types.VK_HOME,
+	"end":       types.VK_END,
+	"pageup":    types.VK_PRIOR,
+	"pagedown":  types.VK_NEXT,
+	"up":        types.VK_UP,
+	"down":      types.VK_DOWN,
+	"left":      types.VK_LEFT,
+	"right":     types.VK_RIGHT,
+	"f1":        types.VK_F1,
+	"f2":        types.VK_F2,
+	"f3":        types.VK_F3,
+	"f4":        types.VK_F4,
+	"f5":        types.VK_F5,
+	"f6":        types.VK_F6,
+	"f7":        types.VK_F7,
+	"f8":        types.VK_F8,
+	"f9":        types.VK_F9,
+	"f10":       types.VK_F10,
+	"f11":       types.VK_F11,
+	"f12":       types.VK_F12,
+}
+
+// parseCombo parses a "ctrl+alt+e"-style hotkey string into a trigger
+// key and the modifier keys that must be held with it. Key names are
+// case-insensitive; the trigger key is always the last "+"-separated
+// part.
+func parseCombo(combo string) (hotkey, error) {
+	var hk hotkey
+
+	parts := strings.Split(combo, "+")
+	for i, part := range parts {
+		name := strings.ToLower(strings.TrimSpace(part))
+		if i < len(parts)-1 {
+			mod, ok := modifierKeys[name]
+			if !ok {
+				return hk, fmt.Errorf("unknown modifier %q in hotkey %q", part, combo)
+			}
+			hk.modifiers = append(hk.modifiers, mod)
+			continue
+		}
+
+		key, err := keyCodeForName(name)
+		if err != nil {
+			return hk, fmt.Errorf("in hotkey %q: %v", combo, err)
+		}
+		hk.key = key
+	}
+
+	return hk, nil
+}
+
+func keyCodeForName(name string) (types.VKCode, error) {
+	switch {
+	case len(name) == 1 && name[0] >= 'a' && name[0] <= 'z':
+		return types.VK_A + types.VKCode(name[0]-'a'), nil
+	case len(name) == 1 && name[0] >= '0' && name[0] <= '9':
+		return types.VK_0 + types.VKCode(name[0]-'0'), nil
+	}
+	if vk, ok := namedKeys[name]; ok {
+		return vk, nil
+	}
+	return 0, fmt.Errorf("unknown key %q", name)
+}
+
+// canonicalModifier maps a left/right-specific modifier VK code (as
+// reported by the low-level keyboard hook) to the generic one used in
+// parsed hotkeys, so "ctrl+e" matches either Ctrl key.
+func canonicalModifier(vk types.VKCode) types.VKCode {
+	switch vk {
+	case types.VK_LCONTROL, types.VK_RCONTROL:
+		return types.VK_CONTROL
+	case types.VK_LSHIFT, types.VK_RSHIFT:
+		return types.VK_SHIFT
+	case types.VK_LMENU, types.VK_RMENU:
+		return types.VK_MENU
+	case types.VK_RWIN:
+		return types.VK_LWIN
+	default:
+		return vk
+	}
+}
+
+// held returns whether every modifier hk requires is currently down.
+func (hk hotkey) held(down map[types.VKCode]bool) bool {
+	for _, mod := range hk.modifiers {
+		if !down[mod] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,82 @@
+package tray
+
+import (
+	"testing"
+
+	"github.com/moutend/go-hook/pkg/types"
+)
+
+func TestParseCombo(t *testing.T) {
+	tests := []struct {
+		combo     string
+		key       types.VKCode
+		modifiers []types.VKCode
+	}{
+		{"ctrl+alt+e", types.VK_E, []types.VKCode{types.VK_CONTROL, types.VK_MENU}},
+		{"ctrl+shift+up", types.VK_UP, []types.VKCode{types.VK_CONTROL, types.VK_SHIFT}},
+		{"f9", types.VK_F9, nil},
+		{"win+1", types.VK_1, []types.VKCode{types.VK_LWIN}},
+		{" Ctrl + E ", types.VK_E, []types.VKCode{types.VK_CONTROL}},
+	}
+
+	for _, tt := range tests {
+		hk, err := parseCombo(tt.combo)
+		if err != nil {
+			t.Fatalf("parseCombo(%q) returned error: %v", tt.combo, err)
+		}
+		if hk.key != tt.key {
+			t.Errorf("parseCombo(%q) key = %v, want %v", tt.combo, hk.key, tt.key)
+		}
+		if len(hk.modifiers) != len(tt.modifiers) {
+			t.Fatalf("parseCombo(%q) modifiers = %v, want %v", tt.combo, hk.modifiers, tt.modifiers)
+		}
+		for i, mod := range tt.modifiers {
+			if hk.modifiers[i] != mod {
+				t.Errorf("parseCombo(%q) modifiers[%d] = %v, want %v", tt.combo, i, hk.modifiers[i], mod)
+			}
+		}
+	}
+}
+
+func TestParseComboErrors(t *testing.T) {
+	for _, combo := range []string{"ctrl+nope", "nonsense", "ctrl+"} {
+		if _, err := parseCombo(combo); err == nil {
+			t.Errorf("parseCombo(%q) expected an error, got nil", combo)
+		}
+	}
+}
+
+func TestHotkeyHeld(t *testing.T) {
+	hk, err := parseCombo("ctrl+alt+e")
+	if err != nil {
+		t.Fatalf("parseCombo failed: %v", err)
+	}
+
+	down := map[types.VKCode]bool{types.VK_CONTROL: true, types.VK_MENU: true}
+	if !hk.held(down) {
+		t.Error("held() = false, want true when both modifiers are down")
+	}
+
+	delete(down, types.VK_MENU)
+	if hk.held(down) {
+		t.Error("held() = true, want false when a modifier is missing")
+	}
+}
+
+func TestCanonicalModifier(t *testing.T) {
+	tests := map[types.VKCode]types.VKCode{
+		types.VK_LCONTROL: types.VK_CONTROL,
+		types.VK_RCONTROL: types.VK_CONTROL,
+		types.VK_LSHIFT:   types.VK_SHIFT,
+		types.VK_RSHIFT:   types.VK_SHIFT,
+		types.VK_LMENU:    types.VK_MENU,
+		types.VK_RMENU:    types.VK_MENU,
+		types.VK_RWIN:     types.VK_LWIN,
+		types.VK_A:        types.VK_A,
+	}
+	for in, want := range tests {
+		if got := canonicalModifier(in); got != want {
+			t.Errorf("canonicalModifier(%v) = %v, want %v", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+// Package tray gives EarGuard a system tray icon and global hotkeys so
+// it can run headless (no console window) from Startup, controlled
+// entirely through the tray menu or keyboard shortcuts.
+package tray
+
+import (
+	"log"
+
+	"github.com/getlantern/systray"
+	"github.com/moutend/go-hook/pkg/keyboard"
+	"github.com/moutend/go-hook/pkg/types"
+)
+
+// Controller is the subset of monitor.Runner the tray and hotkeys
+// drive. It's an interface, not a *monitor.Runner, so this package
+// doesn't need to import monitor.
+type Controller interface {
+	TogglePause()
+	RestoreNow()
+	AdjustThreshold(delta float64)
+	Stop()
+}
+
+// Config carries the hotkey bindings to register; both are optional.
+type Config struct {
+	HotkeyToggle       string
+	HotkeyPanicRestore string
+}
+
+// Run sets up the tray icon, menu and hotkeys and returns; the menu
+// and hotkey handlers keep running on their own goroutines until Quit
+// is clicked or the process exits. It's meant to be run as
+// systray.Run's onReady callback target, so call it from main via
+// systray.Run(func(){ tray.Run(...) }, onExit).
+func Run(ctrl Controller, config Config, icon []byte) {
+	systray.SetIcon(icon)
+	systray.SetTitle("EarGuard")
+	systray.SetTooltip("EarGuard - audio ear protection")
+
+	mPause := systray.AddMenuItem("Pause/Resume monitoring", "Toggle monitoring on or off")
+	mRestore := systray.AddMenuItem("Restore volume now", "Cancel ducking immediately")
+	mThresholdUp := systray.AddMenuItem("Threshold up", "Make EarGuard less sensitive")
+	mThresholdDown := systray.AddMenuItem("Threshold down", "Make EarGuard more sensitive")
+	systray.AddSeparator()
+	mQuit := systray.AddMenuItem("Quit", "Stop EarGuard")
+
+	go func() {
+		for {
+			select {
+			case <-mPause.ClickedCh:
+				ctrl.TogglePause()
+			case <-mRestore.ClickedCh:
+				ctrl.RestoreNow()
+			case <-mThresholdUp.ClickedCh:
+				ctrl.AdjustThreshold(1)
+			case <-mThresholdDown.ClickedCh:
+				ctrl.AdjustThreshold(-1)
+			case <-mQuit.ClickedCh:
+				ctrl.Stop()
+				systray.Quit()
+				return
+			}
+		}
+	}()
+
+	registerHotkeys(ctrl, config)
+}
+
+// registerHotkeys wires Config's key combos to Controller actions via
+// moutend/go-hook's low-level keyboard hook, so they work even when
+// EarGuard doesn't have window focus. go-hook only reports raw
+// key-down/key-up events for a single VK code at a time, so the
+// combos are matched by tracking which keys are currently held.
+func registerHotkeys(ctrl Controller, config Config) {
+	var bindings []binding
+
+	bind := func(combo string, action func()) {
+		if combo == "" {
+			return
+		}
+		hk, err := parseCombo(combo)
+		if err != nil {
+			log.Printf("ignoring hotkey %q: %v", combo, err)
+			return
+		}
+		bindings = append(bindings, binding{hk: hk, action: action})
+	}
+	bind(config.HotkeyToggle, ctrl.TogglePause)
+	bind(config.HotkeyPanicRestore, ctrl.RestoreNow)
+
+	if len(bindings) == 0 {
+		return
+	}
+
+	events := make(chan types.KeyboardEvent, 32)
+	if err := keyboard.Install(nil, events); err != nil {
+		log.Printf("failed to install keyboard hook: %v", err)
+		return
+	}
+
+	go func() {
+		defer keyboard.Uninstall()
+
+		down := make(map[types.VKCode]bool)
+		for ev := range events {
+			vk := ev.VKCode
+			canon := canonicalModifier(vk)
+
+			switch ev.Message {
+			case types.WM_KEYDOWN, types.WM_SYSKEYDOWN:
+				alreadyDown := down[vk]
+				down[vk] = true
+				down[canon] = true
+				if alreadyDown {
+					continue // key-repeat from holding it down, not a new press
+				}
+				for _, b := range bindings {
+					if b.hk.key == vk && b.hk.held(down) {
+						b.action()
+					}
+				}
+			case types.WM_KEYUP, types.WM_SYSKEYUP:
+				delete(down, vk)
+				delete(down, canon)
+			}
+		}
+	}()
+}